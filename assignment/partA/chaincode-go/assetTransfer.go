@@ -5,11 +5,16 @@ SPDX-License-Identifier: Apache-2.0
 package main
 
 import (
+	"crypto/ecdsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
 
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
@@ -26,9 +31,93 @@ type Account struct {
 
 // Document represents a document in the private data collection
 type Document struct {
+	DocID        string        `json:"docID"`
+	DocTitle     string        `json:"docTitle"`
+	DocData      string        `json:"docData"`
+	DocDataHash  string        `json:"docDataHash"`
+	DocPrice     int           `json:"docPrice"`
+	Endorsements []Endorsement `json:"endorsements,omitempty"`
+}
+
+// Endorsement records that a named signer has vouched for a document's
+// authenticity, independently of the ledger's own endorsement policy
+type Endorsement struct {
+	SignerMSP     string `json:"signerMSP"`
+	SignerCN      string `json:"signerCN"`
+	SigB64        string `json:"sigB64"`
+	SignerCertB64 string `json:"signerCertB64"`
+	Timestamp     int64  `json:"timestamp"`
+}
+
+// EndorsementReport describes the outcome of re-verifying a single stored
+// endorsement against a document's current DocData
+type EndorsementReport struct {
+	SignerMSP string `json:"signerMSP"`
+	SignerCN  string `json:"signerCN"`
+	Valid     bool   `json:"valid"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Bond is the collateral an organization posts, under composite key
+// bond~<bondID>, to back its names in the naming registry
+type Bond struct {
+	OwnerMSP string `json:"ownerMSP"`
+	Balance  int    `json:"balance"`
+}
+
+// NameRecord maps a human-readable name to a document, stored under
+// composite key name~<name>
+type NameRecord struct {
+	Name        string `json:"name"`
+	DocDataHash string `json:"docDataHash"`
+	OwnerMSP    string `json:"ownerMSP"`
+	ExpiryTs    int64  `json:"expiryTs"`
+	BondID      string `json:"bondID"`
+}
+
+// AuctionPhase tracks where a sealed-bid name auction is in its lifecycle
+type AuctionPhase string
+
+const (
+	AuctionPhaseCommit    AuctionPhase = "commit"
+	AuctionPhaseReveal    AuctionPhase = "reveal"
+	AuctionPhaseFinalised AuctionPhase = "finalised"
+)
+
+// Bid is one organization's sealed bid in a name auction. Amount and Nonce
+// stay zero/empty until RevealBid discloses them
+type Bid struct {
+	BidderMSP  string `json:"bidderMSP"`
+	CommitHash string `json:"commitHash"`
+	Amount     int    `json:"amount"`
+	Nonce      string `json:"nonce"`
+	Revealed   bool   `json:"revealed"`
+}
+
+// Auction is a sealed-bid, second-price auction for ownership of a name,
+// stored under composite key auction~<auctionID>
+type Auction struct {
+	AuctionID      string       `json:"auctionID"`
+	Name           string       `json:"name"`
+	Phase          AuctionPhase `json:"phase"`
+	CommitDeadline int64        `json:"commitDeadline"`
+	RevealDeadline int64        `json:"revealDeadline"`
+	Bids           []Bid        `json:"bids"`
+	Winner         string       `json:"winner,omitempty"`
+}
+
+// nameRenewalPeriodSeconds is how long a name registration lasts before it
+// must be renewed, or becomes reclaimable if left to expire
+const nameRenewalPeriodSeconds = int64(30 * 24 * 60 * 60)
+
+// nameRenewalFee is charged against a name's bond each time SetName renews it
+const nameRenewalFee = 10
+
+// MarketplaceListing is the public world-state record that advertises a
+// document for sale without exposing its private DocData
+type MarketplaceListing struct {
 	DocID       string `json:"docID"`
 	DocTitle    string `json:"docTitle"`
-	DocData     string `json:"docData"`
 	DocDataHash string `json:"docDataHash"`
 	DocPrice    int    `json:"docPrice"`
 }
@@ -47,8 +136,13 @@ func (s *SmartContract) AddBalance(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("amount not found in transient data")
 	}
 
-	amount := 0
-	err = json.Unmarshal(amountBytes, &amount)
+	type AddBalanceData struct {
+		Amount         int    `json:"amount"`
+		IdempotencyKey string `json:"idempotencyKey"`
+	}
+
+	var data AddBalanceData
+	err = json.Unmarshal(amountBytes, &data)
 	if err != nil {
 		return fmt.Errorf("error unmarshaling amount: %v", err)
 	}
@@ -59,6 +153,12 @@ func (s *SmartContract) AddBalance(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("failed to get client org ID: %v", err)
 	}
 
+	if record, err := s.checkIdempotency(ctx, clientOrgID, data.IdempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
 	// Get current account balance
 	accountBytes, err := ctx.GetStub().GetState(clientOrgID)
 	if err != nil {
@@ -74,7 +174,7 @@ func (s *SmartContract) AddBalance(ctx contractapi.TransactionContextInterface)
 	}
 
 	// Update balance
-	account.Balance += amount
+	account.Balance += data.Amount
 
 	// Save updated account
 	accountBytes, err = json.Marshal(account)
@@ -82,7 +182,18 @@ func (s *SmartContract) AddBalance(ctx contractapi.TransactionContextInterface)
 		return err
 	}
 
-	return ctx.GetStub().PutState(clientOrgID, accountBytes)
+	if err := ctx.GetStub().PutState(clientOrgID, accountBytes); err != nil {
+		return err
+	}
+
+	if err := s.recordIdempotency(ctx, clientOrgID, data.IdempotencyKey, fmt.Sprintf("balance=%d", account.Balance)); err != nil {
+		return err
+	}
+
+	return s.emitEvent(ctx, "balance.changed", map[string]interface{}{
+		"orgID":   clientOrgID,
+		"balance": account.Balance,
+	})
 }
 
 // AddDocument adds a new document to the organization's private collection
@@ -99,15 +210,21 @@ func (s *SmartContract) AddDocument(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("document not found in transient data")
 	}
 
-	var doc Document
-	err = json.Unmarshal(docBytes, &doc)
+	type AddDocumentData struct {
+		Document       Document `json:"document"`
+		IdempotencyKey string   `json:"idempotencyKey"`
+	}
+
+	var data AddDocumentData
+	err = json.Unmarshal(docBytes, &data)
 	if err != nil {
 		return fmt.Errorf("error unmarshaling document: %v", err)
 	}
+	doc := data.Document
 
-	// Compute document hash
-	hash := sha256.Sum256([]byte(doc.DocData))
-	doc.DocDataHash = hex.EncodeToString(hash[:])
+	if doc.DocPrice <= 0 {
+		return fmt.Errorf("docPrice must be positive")
+	}
 
 	// Get client org ID
 	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
@@ -115,6 +232,16 @@ func (s *SmartContract) AddDocument(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("failed to get client org ID: %v", err)
 	}
 
+	if record, err := s.checkIdempotency(ctx, clientOrgID, data.IdempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
+	// Compute document hash
+	hash := sha256.Sum256([]byte(doc.DocData))
+	doc.DocDataHash = hex.EncodeToString(hash[:])
+
 	// Store in private data collection
 	docJSON, err := json.Marshal(doc)
 	if err != nil {
@@ -123,7 +250,21 @@ func (s *SmartContract) AddDocument(ctx contractapi.TransactionContextInterface)
 
 	// Use collection name format: "_implicit_org_<OrgName>"
 	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
-	return ctx.GetStub().PutPrivateData(collectionName, doc.DocID, docJSON)
+	if err := ctx.GetStub().PutPrivateData(collectionName, doc.DocID, docJSON); err != nil {
+		return err
+	}
+
+	if err := s.recordIdempotency(ctx, clientOrgID, data.IdempotencyKey, doc.DocDataHash); err != nil {
+		return err
+	}
+
+	return s.emitEvent(ctx, "document.added", map[string]interface{}{
+		"orgID":       clientOrgID,
+		"docID":       doc.DocID,
+		"docTitle":    doc.DocTitle,
+		"docPrice":    doc.DocPrice,
+		"docDataHash": doc.DocDataHash,
+	})
 }
 
 // GetBalance retrieves the organization's account balance
@@ -168,9 +309,10 @@ func (s *SmartContract) UpdateDocument(ctx contractapi.TransactionContextInterfa
 	}
 
 	type UpdateData struct {
-		DocID      string `json:"docID"`
-		NewDocData string `json:"newDocData"`
-		UpdateHash bool   `json:"updateHash"`
+		DocID          string `json:"docID"`
+		NewDocData     string `json:"newDocData"`
+		UpdateHash     bool   `json:"updateHash"`
+		IdempotencyKey string `json:"idempotencyKey"`
 	}
 
 	var updateData UpdateData
@@ -185,6 +327,12 @@ func (s *SmartContract) UpdateDocument(ctx contractapi.TransactionContextInterfa
 		return fmt.Errorf("failed to get client org ID: %v", err)
 	}
 
+	if record, err := s.checkIdempotency(ctx, clientOrgID, updateData.IdempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
 	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
 
 	// Get existing document
@@ -214,11 +362,45 @@ func (s *SmartContract) UpdateDocument(ctx contractapi.TransactionContextInterfa
 		return err
 	}
 
-	return ctx.GetStub().PutPrivateData(collectionName, updateData.DocID, docJSON)
+	if err := ctx.GetStub().PutPrivateData(collectionName, updateData.DocID, docJSON); err != nil {
+		return err
+	}
+
+	// Keep a live marketplace listing (if any) from silently going stale
+	// against the document it advertises.
+	if err := refreshMarketplaceListingIfPresent(ctx, clientOrgID, doc); err != nil {
+		return err
+	}
+
+	if err := s.recordIdempotency(ctx, clientOrgID, updateData.IdempotencyKey, doc.DocDataHash); err != nil {
+		return err
+	}
+
+	return s.emitEvent(ctx, "document.updated", map[string]interface{}{
+		"orgID":       clientOrgID,
+		"docID":       doc.DocID,
+		"docDataHash": doc.DocDataHash,
+	})
+}
+
+// PageRequest drives pagination over the private document collection
+type PageRequest struct {
+	Bookmark string `json:"bookmark"`
+	PageSize int32  `json:"pageSize"`
+}
+
+// DocumentPage is one page of documents plus the bookmark to fetch the next
+type DocumentPage struct {
+	Documents    []Document `json:"documents"`
+	NextBookmark string     `json:"nextBookmark"`
+	FetchedCount int32      `json:"fetchedCount"`
 }
 
-// GetAllDocuments returns all documents in the organization's private collection
-func (s *SmartContract) GetAllDocuments(ctx contractapi.TransactionContextInterface) ([]Document, error) {
+// GetAllDocuments returns one page of documents from the organization's
+// private collection. Each call reads and decodes every document in the
+// collection through the range iterator and then selects the requested page
+// in memory; only the returned page is bounded by PageSize.
+func (s *SmartContract) GetAllDocuments(ctx contractapi.TransactionContextInterface, page PageRequest) (*DocumentPage, error) {
 	// Get client org ID
 	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
@@ -227,13 +409,93 @@ func (s *SmartContract) GetAllDocuments(ctx contractapi.TransactionContextInterf
 
 	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
 
-	// Get all documents
+	// Private collections only expose GetPrivateDataByRange, with no
+	// pageSize/bookmark parameters (those only exist for public world-state
+	// range/query reads), so pagination is applied in memory over the key
+	// order the range iterator already returns.
 	iterator, err := ctx.GetStub().GetPrivateDataByRange(collectionName, "", "")
 	if err != nil {
 		return nil, err
 	}
 	defer iterator.Close()
 
+	var keys []string
+	docsByKey := make(map[string]Document)
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var doc Document
+		if err := json.Unmarshal(response.Value, &doc); err != nil {
+			return nil, err
+		}
+		keys = append(keys, response.Key)
+		docsByKey[response.Key] = doc
+	}
+
+	pageKeys, nextBookmark := paginateKeys(keys, page.Bookmark, page.PageSize)
+
+	documents := make([]Document, 0, len(pageKeys))
+	for _, key := range pageKeys {
+		documents = append(documents, docsByKey[key])
+	}
+
+	return &DocumentPage{
+		Documents:    documents,
+		NextBookmark: nextBookmark,
+		FetchedCount: int32(len(documents)),
+	}, nil
+}
+
+// paginateKeys is the pure windowing logic behind GetAllDocuments' in-memory
+// pagination. keys must already be in the range iterator's ascending order.
+// bookmark is the last key returned by the previous page ("" for the first
+// page); pageSize <= 0 means no limit. It returns the keys for this page and
+// the bookmark to pass for the next one ("" if nothing remains).
+func paginateKeys(keys []string, bookmark string, pageSize int32) (pageKeys []string, nextBookmark string) {
+	for _, key := range keys {
+		if bookmark != "" && key <= bookmark {
+			continue
+		}
+		if pageSize > 0 && int32(len(pageKeys)) >= pageSize {
+			break
+		}
+		pageKeys = append(pageKeys, key)
+	}
+
+	if len(pageKeys) == 0 {
+		return pageKeys, ""
+	}
+
+	last := pageKeys[len(pageKeys)-1]
+	for _, key := range keys {
+		if key > last {
+			return pageKeys, last
+		}
+	}
+
+	return pageKeys, ""
+}
+
+// QueryDocuments passes a Mango selector straight through to CouchDB,
+// letting callers filter the private collection by fields such as DocPrice
+// ranges or title prefixes. Requires CouchDB as the state database.
+func (s *SmartContract) QueryDocuments(ctx contractapi.TransactionContextInterface, selectorJSON string) ([]Document, error) {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
+
+	iterator, err := ctx.GetStub().GetPrivateDataQueryResult(collectionName, selectorJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
 	var documents []Document
 	for iterator.HasNext() {
 		response, err := iterator.Next()
@@ -278,6 +540,1262 @@ func (s *SmartContract) GetDocument(ctx contractapi.TransactionContextInterface,
 	return &doc, nil
 }
 
+// ListDocumentForSale publishes one of the caller's own documents to the
+// public marketplace index so other organizations can discover it without
+// reading the owning org's private collection
+func (s *SmartContract) ListDocumentForSale(ctx contractapi.TransactionContextInterface, docID string) error {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
+
+	docJSON, err := ctx.GetStub().GetPrivateData(collectionName, docID)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %v", err)
+	}
+	if docJSON == nil {
+		return fmt.Errorf("document %s not found", docID)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(docJSON, &doc); err != nil {
+		return err
+	}
+
+	if doc.DocPrice <= 0 {
+		return fmt.Errorf("docPrice must be positive")
+	}
+
+	return putMarketplaceListing(ctx, clientOrgID, doc)
+}
+
+// putMarketplaceListing writes (or overwrites) the public marketplace entry
+// for doc under the owning organization's listing key
+func putMarketplaceListing(ctx contractapi.TransactionContextInterface, clientOrgID string, doc Document) error {
+	marketKey, err := ctx.GetStub().CreateCompositeKey("market", []string{clientOrgID, doc.DocID})
+	if err != nil {
+		return fmt.Errorf("failed to create marketplace key: %v", err)
+	}
+
+	listing := MarketplaceListing{
+		DocID:       doc.DocID,
+		DocTitle:    doc.DocTitle,
+		DocDataHash: doc.DocDataHash,
+		DocPrice:    doc.DocPrice,
+	}
+
+	listingJSON, err := json.Marshal(listing)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(marketKey, listingJSON)
+}
+
+// refreshMarketplaceListingIfPresent re-publishes doc's current DocDataHash
+// and DocPrice to its marketplace entry if one already exists, so a
+// document's listing can't silently go stale after UpdateDocument changes
+// the data it advertises.
+func refreshMarketplaceListingIfPresent(ctx contractapi.TransactionContextInterface, clientOrgID string, doc Document) error {
+	marketKey, err := ctx.GetStub().CreateCompositeKey("market", []string{clientOrgID, doc.DocID})
+	if err != nil {
+		return fmt.Errorf("failed to create marketplace key: %v", err)
+	}
+
+	listingBytes, err := ctx.GetStub().GetState(marketKey)
+	if err != nil {
+		return fmt.Errorf("failed to read marketplace listing: %v", err)
+	}
+	if listingBytes == nil {
+		return nil
+	}
+
+	return putMarketplaceListing(ctx, clientOrgID, doc)
+}
+
+// DelistDocument removes one of the caller's own documents from the public
+// marketplace index
+func (s *SmartContract) DelistDocument(ctx contractapi.TransactionContextInterface, docID string) error {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	marketKey, err := ctx.GetStub().CreateCompositeKey("market", []string{clientOrgID, docID})
+	if err != nil {
+		return fmt.Errorf("failed to create marketplace key: %v", err)
+	}
+
+	listingBytes, err := ctx.GetStub().GetState(marketKey)
+	if err != nil {
+		return fmt.Errorf("failed to read marketplace listing: %v", err)
+	}
+	if listingBytes == nil {
+		return fmt.Errorf("document %s is not listed for sale", docID)
+	}
+
+	return ctx.GetStub().DelState(marketKey)
+}
+
+// GetMarketplaceListings returns every document currently listed for sale
+// across all organizations
+func (s *SmartContract) GetMarketplaceListings(ctx contractapi.TransactionContextInterface) ([]MarketplaceListing, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("market", []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	var listings []MarketplaceListing
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var listing MarketplaceListing
+		if err := json.Unmarshal(response.Value, &listing); err != nil {
+			return nil, err
+		}
+		listings = append(listings, listing)
+	}
+
+	return listings, nil
+}
+
+// verifyDocumentDataHash is a pure check that docData still hashes to
+// expectedHash, used to validate a seller-supplied document against the
+// publicly posted marketplace listing before it is trusted or paid for.
+func verifyDocumentDataHash(docData string, expectedHash string) error {
+	hash := sha256.Sum256([]byte(docData))
+	if hex.EncodeToString(hash[:]) != expectedHash {
+		return fmt.Errorf("document data hash does not match marketplace listing")
+	}
+	return nil
+}
+
+// computePurchaseTransfer is the pure debit/credit math behind
+// PurchaseDocument: it rejects a non-positive price outright and refuses to
+// move money the buyer doesn't have, so a bad listing price can't mint or
+// destroy balance on either side of the trade.
+func computePurchaseTransfer(buyerBalance, sellerBalance, price int) (newBuyerBalance, newSellerBalance int, err error) {
+	if price <= 0 {
+		return 0, 0, fmt.Errorf("price must be positive")
+	}
+	if buyerBalance < price {
+		return 0, 0, fmt.Errorf("insufficient balance: have %d, need %d", buyerBalance, price)
+	}
+
+	return buyerBalance - price, sellerBalance + price, nil
+}
+
+// PurchaseDocument lets a buying organization purchase a document listed by
+// a selling organization. It reads {sellerOrgID, docID, document} from
+// transient data, where "document" is the full seller-endorsed record
+// (including DocData) obtained off-chain from the seller's organization.
+// The buyer's peer independently verifies sha256(DocData) against the
+// DocDataHash published in the marketplace listing before trusting it,
+// debits the buyer's balance and credits the seller's balance by DocPrice,
+// and finally writes the verified document into the buyer's own private
+// collection.
+func (s *SmartContract) PurchaseDocument(ctx contractapi.TransactionContextInterface) error {
+	transientData, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient data: %v", err)
+	}
+
+	purchaseBytes, ok := transientData["purchase"]
+	if !ok {
+		return fmt.Errorf("purchase not found in transient data")
+	}
+
+	type PurchaseData struct {
+		SellerOrgID    string   `json:"sellerOrgID"`
+		DocID          string   `json:"docID"`
+		Document       Document `json:"document"`
+		IdempotencyKey string   `json:"idempotencyKey"`
+	}
+
+	var purchase PurchaseData
+	if err := json.Unmarshal(purchaseBytes, &purchase); err != nil {
+		return fmt.Errorf("error unmarshaling purchase data: %v", err)
+	}
+
+	if purchase.Document.DocID != purchase.DocID {
+		return fmt.Errorf("document ID %s does not match purchase request for %s", purchase.Document.DocID, purchase.DocID)
+	}
+
+	buyerOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+	if buyerOrgID == purchase.SellerOrgID {
+		return fmt.Errorf("buyer and seller organization cannot be the same")
+	}
+
+	if record, err := s.checkIdempotency(ctx, buyerOrgID, purchase.IdempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
+	marketKey, err := ctx.GetStub().CreateCompositeKey("market", []string{purchase.SellerOrgID, purchase.DocID})
+	if err != nil {
+		return fmt.Errorf("failed to create marketplace key: %v", err)
+	}
+
+	listingBytes, err := ctx.GetStub().GetState(marketKey)
+	if err != nil {
+		return fmt.Errorf("failed to read marketplace listing: %v", err)
+	}
+	if listingBytes == nil {
+		return fmt.Errorf("document %s is not listed for sale by %s", purchase.DocID, purchase.SellerOrgID)
+	}
+
+	var listing MarketplaceListing
+	if err := json.Unmarshal(listingBytes, &listing); err != nil {
+		return err
+	}
+
+	// Verify the seller-supplied document against the public listing hash
+	// before the buyer's peer trusts or pays for it.
+	if err := verifyDocumentDataHash(purchase.Document.DocData, listing.DocDataHash); err != nil {
+		return fmt.Errorf("%v for %s", err, purchase.DocID)
+	}
+
+	// Get buyer account
+	buyerAccountBytes, err := ctx.GetStub().GetState(buyerOrgID)
+	if err != nil {
+		return fmt.Errorf("failed to read account: %v", err)
+	}
+	var buyerAccount Account
+	if buyerAccountBytes != nil {
+		if err := json.Unmarshal(buyerAccountBytes, &buyerAccount); err != nil {
+			return err
+		}
+	}
+
+	// Get seller account
+	sellerAccountBytes, err := ctx.GetStub().GetState(purchase.SellerOrgID)
+	if err != nil {
+		return fmt.Errorf("failed to read account: %v", err)
+	}
+	var sellerAccount Account
+	if sellerAccountBytes != nil {
+		if err := json.Unmarshal(sellerAccountBytes, &sellerAccount); err != nil {
+			return err
+		}
+	}
+
+	// Debit buyer, credit seller
+	newBuyerBalance, newSellerBalance, err := computePurchaseTransfer(buyerAccount.Balance, sellerAccount.Balance, listing.DocPrice)
+	if err != nil {
+		return err
+	}
+	buyerAccount.Balance = newBuyerBalance
+	sellerAccount.Balance = newSellerBalance
+
+	buyerAccountBytes, err = json.Marshal(buyerAccount)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(buyerOrgID, buyerAccountBytes); err != nil {
+		return fmt.Errorf("failed to update buyer account: %v", err)
+	}
+
+	sellerAccountBytes, err = json.Marshal(sellerAccount)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(purchase.SellerOrgID, sellerAccountBytes); err != nil {
+		return fmt.Errorf("failed to update seller account: %v", err)
+	}
+
+	// Copy the verified document into the buyer's private collection
+	buyerCollection := fmt.Sprintf("_implicit_org_%s", buyerOrgID)
+	docJSON, err := json.Marshal(purchase.Document)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutPrivateData(buyerCollection, purchase.DocID, docJSON); err != nil {
+		return err
+	}
+
+	if err := s.recordIdempotency(ctx, buyerOrgID, purchase.IdempotencyKey, fmt.Sprintf("buyerBalance=%d", buyerAccount.Balance)); err != nil {
+		return err
+	}
+
+	return s.emitEvent(ctx, "document.purchased", map[string]interface{}{
+		"docID":         purchase.DocID,
+		"buyerOrgID":    buyerOrgID,
+		"sellerOrgID":   purchase.SellerOrgID,
+		"price":         listing.DocPrice,
+		"buyerBalance":  buyerAccount.Balance,
+		"sellerBalance": sellerAccount.Balance,
+	})
+}
+
+// idempotencyTTLSeconds bounds how long an idempotency record is honoured.
+// Records older than this are swept lazily the next time they are looked up
+// so the idem~ keyspace doesn't grow unbounded.
+const idempotencyTTLSeconds = int64(24 * 60 * 60)
+
+// IdempotencyRecord is stored under composite key idem~<mspid>~<key> to let
+// a retried submit of AddBalance, AddDocument or UpdateDocument be detected
+// and short-circuited instead of double-applied.
+type IdempotencyRecord struct {
+	TxID      string `json:"txID"`
+	Timestamp int64  `json:"timestamp"`
+	Result    string `json:"result"`
+}
+
+func idempotencyStateKey(ctx contractapi.TransactionContextInterface, clientOrgID, idempotencyKey string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("idem", []string{clientOrgID, idempotencyKey})
+}
+
+// checkIdempotency returns the previously recorded outcome for idempotencyKey,
+// or nil if this is the first time it has been seen. An empty idempotencyKey
+// opts out of dedupe entirely. Expired records are swept on read.
+func (s *SmartContract) checkIdempotency(ctx contractapi.TransactionContextInterface, clientOrgID, idempotencyKey string) (*IdempotencyRecord, error) {
+	if idempotencyKey == "" {
+		return nil, nil
+	}
+
+	key, err := idempotencyStateKey(ctx, clientOrgID, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create idempotency key: %v", err)
+	}
+
+	recordBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency record: %v", err)
+	}
+	if recordBytes == nil {
+		return nil, nil
+	}
+
+	var record IdempotencyRecord
+	if err := json.Unmarshal(recordBytes, &record); err != nil {
+		return nil, err
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+
+	if isIdempotencyRecordExpired(record, txTimestamp.Seconds) {
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	return &record, nil
+}
+
+// isIdempotencyRecordExpired reports whether record is older than
+// idempotencyTTLSeconds as of nowSeconds. It is a pure function so the
+// sweep threshold can be unit tested without a ledger.
+func isIdempotencyRecordExpired(record IdempotencyRecord, nowSeconds int64) bool {
+	return nowSeconds-record.Timestamp > idempotencyTTLSeconds
+}
+
+// recordIdempotency stores the outcome of a state-changing call as part of
+// the same transaction that performed the mutation, so a later retry with
+// the same idempotencyKey is recognised by checkIdempotency.
+func (s *SmartContract) recordIdempotency(ctx contractapi.TransactionContextInterface, clientOrgID, idempotencyKey, result string) error {
+	if idempotencyKey == "" {
+		return nil
+	}
+
+	key, err := idempotencyStateKey(ctx, clientOrgID, idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency key: %v", err)
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+
+	record := IdempotencyRecord{
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: txTimestamp.Seconds,
+		Result:    result,
+	}
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, recordBytes)
+}
+
+// GetIdempotencyRecord looks up the stored outcome for a previously
+// submitted idempotencyKey, scoped to the caller's own organization. It
+// returns nil if no record exists or it has expired.
+func (s *SmartContract) GetIdempotencyRecord(ctx contractapi.TransactionContextInterface, idempotencyKey string) (*IdempotencyRecord, error) {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	return s.checkIdempotency(ctx, clientOrgID, idempotencyKey)
+}
+
+// SignDocument lets the caller vouch for a document already present in
+// their organization's private collection. It reads {docID, signature}
+// (signature base64-encoded ASN.1 DER) from transient data, verifies the
+// ECDSA signature over DocDataHash||docID against the invoker's own X.509
+// certificate, and appends the resulting Endorsement to the document.
+func (s *SmartContract) SignDocument(ctx contractapi.TransactionContextInterface) error {
+	transientData, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient data: %v", err)
+	}
+
+	sigBytes, ok := transientData["signature"]
+	if !ok {
+		return fmt.Errorf("signature not found in transient data")
+	}
+
+	type SignatureData struct {
+		DocID     string `json:"docID"`
+		Signature string `json:"signature"`
+	}
+
+	var sigData SignatureData
+	if err := json.Unmarshal(sigBytes, &sigData); err != nil {
+		return fmt.Errorf("error unmarshaling signature data: %v", err)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
+
+	docJSON, err := ctx.GetStub().GetPrivateData(collectionName, sigData.DocID)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %v", err)
+	}
+	if docJSON == nil {
+		return fmt.Errorf("document %s not found", sigData.DocID)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(docJSON, &doc); err != nil {
+		return err
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to get client certificate: %v", err)
+	}
+
+	pubKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("client certificate does not use an ECDSA public key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sigData.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	hash := sha256.Sum256([]byte(doc.DocDataHash + sigData.DocID))
+	if !ecdsa.VerifyASN1(pubKey, hash[:], sig) {
+		return fmt.Errorf("signature verification failed for document %s", sigData.DocID)
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+
+	doc.Endorsements = append(doc.Endorsements, Endorsement{
+		SignerMSP:     clientOrgID,
+		SignerCN:      cert.Subject.CommonName,
+		SigB64:        sigData.Signature,
+		SignerCertB64: base64.StdEncoding.EncodeToString(cert.Raw),
+		Timestamp:     txTimestamp.Seconds,
+	})
+
+	docJSON, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutPrivateData(collectionName, sigData.DocID, docJSON); err != nil {
+		return err
+	}
+
+	return s.emitEvent(ctx, "document.signed", map[string]interface{}{
+		"docID":     sigData.DocID,
+		"signerMSP": clientOrgID,
+		"signerCN":  cert.Subject.CommonName,
+	})
+}
+
+// VerifyDocument re-hashes the caller's copy of a document's DocData and
+// re-verifies every stored endorsement against the signer's certificate
+// captured at signing time, returning a structured report so callers can
+// see which endorsements are still valid without trusting the holder's word.
+func (s *SmartContract) VerifyDocument(ctx contractapi.TransactionContextInterface, docID string) ([]EndorsementReport, error) {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
+
+	docJSON, err := ctx.GetStub().GetPrivateData(collectionName, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %v", err)
+	}
+	if docJSON == nil {
+		return nil, fmt.Errorf("document %s not found", docID)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(docJSON, &doc); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(doc.DocData))
+	if hex.EncodeToString(hash[:]) != doc.DocDataHash {
+		return nil, fmt.Errorf("document %s has been tampered with: DocData no longer matches DocDataHash", docID)
+	}
+
+	messageHash := sha256.Sum256([]byte(doc.DocDataHash + docID))
+
+	reports := make([]EndorsementReport, 0, len(doc.Endorsements))
+	for _, endorsement := range doc.Endorsements {
+		valid, reason := verifyEndorsementSignature(endorsement, messageHash[:])
+		reports = append(reports, EndorsementReport{
+			SignerMSP: endorsement.SignerMSP,
+			SignerCN:  endorsement.SignerCN,
+			Valid:     valid,
+			Reason:    reason,
+		})
+	}
+
+	return reports, nil
+}
+
+// verifyEndorsementSignature re-verifies a single stored endorsement against
+// messageHash using the certificate captured at signing time. It is a pure
+// function (no ledger access) so the ECDSA re-verification path can be unit
+// tested directly, independent of VerifyDocument's private-data lookups.
+func verifyEndorsementSignature(endorsement Endorsement, messageHash []byte) (valid bool, reason string) {
+	certDER, err := base64.StdEncoding.DecodeString(endorsement.SignerCertB64)
+	if err != nil {
+		return false, "invalid stored certificate encoding"
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return false, "unable to parse stored certificate"
+	}
+
+	pubKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return false, "stored certificate does not use an ECDSA public key"
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(endorsement.SigB64)
+	if err != nil {
+		return false, "invalid stored signature encoding"
+	}
+
+	if !ecdsa.VerifyASN1(pubKey, messageHash, sig) {
+		return false, "signature no longer verifies against the stored certificate"
+	}
+
+	return true, ""
+}
+
+// RevokeEndorsement removes a signer's own endorsement from a document in
+// the caller's private collection. It is gated on identity equality: only
+// the signer identified by signerCN, from the caller's own organization,
+// may revoke it.
+func (s *SmartContract) RevokeEndorsement(ctx contractapi.TransactionContextInterface, docID string, signerCN string) error {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to get client certificate: %v", err)
+	}
+
+	if cert.Subject.CommonName != signerCN {
+		return fmt.Errorf("caller identity %s is not authorized to revoke endorsement by %s", cert.Subject.CommonName, signerCN)
+	}
+
+	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
+
+	docJSON, err := ctx.GetStub().GetPrivateData(collectionName, docID)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %v", err)
+	}
+	if docJSON == nil {
+		return fmt.Errorf("document %s not found", docID)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(docJSON, &doc); err != nil {
+		return err
+	}
+
+	remaining, removed := removeEndorsement(doc.Endorsements, clientOrgID, signerCN)
+	if !removed {
+		return fmt.Errorf("no endorsement by %s found on document %s", signerCN, docID)
+	}
+
+	doc.Endorsements = remaining
+
+	docJSON, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(collectionName, docID, docJSON)
+}
+
+// removeEndorsement returns endorsements with every entry matching both
+// signerMSP and signerCN dropped. It is a pure function so the identity-
+// matching logic can be unit tested without a ledger.
+func removeEndorsement(endorsements []Endorsement, signerMSP, signerCN string) (remaining []Endorsement, removed bool) {
+	remaining = make([]Endorsement, 0, len(endorsements))
+	for _, endorsement := range endorsements {
+		if endorsement.SignerMSP == signerMSP && endorsement.SignerCN == signerCN {
+			removed = true
+			continue
+		}
+		remaining = append(remaining, endorsement)
+	}
+	return remaining, removed
+}
+
+func bondStateKey(ctx contractapi.TransactionContextInterface, bondID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("bond", []string{bondID})
+}
+
+func nameStateKey(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("name", []string{name})
+}
+
+func auctionStateKey(ctx contractapi.TransactionContextInterface, auctionID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("auction", []string{auctionID})
+}
+
+func (s *SmartContract) getBond(ctx contractapi.TransactionContextInterface, bondID string) (*Bond, error) {
+	key, err := bondStateKey(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	bondBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bond: %v", err)
+	}
+	if bondBytes == nil {
+		return nil, fmt.Errorf("bond %s not found", bondID)
+	}
+
+	var bond Bond
+	if err := json.Unmarshal(bondBytes, &bond); err != nil {
+		return nil, err
+	}
+
+	return &bond, nil
+}
+
+func (s *SmartContract) putBond(ctx contractapi.TransactionContextInterface, bondID string, bond *Bond) error {
+	key, err := bondStateKey(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	bondBytes, err := json.Marshal(bond)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, bondBytes)
+}
+
+func (s *SmartContract) getAuction(ctx contractapi.TransactionContextInterface, auctionID string) (*Auction, error) {
+	key, err := auctionStateKey(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+
+	auctionBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auction: %v", err)
+	}
+	if auctionBytes == nil {
+		return nil, fmt.Errorf("auction %s not found", auctionID)
+	}
+
+	var auction Auction
+	if err := json.Unmarshal(auctionBytes, &auction); err != nil {
+		return nil, err
+	}
+
+	return &auction, nil
+}
+
+func (s *SmartContract) putAuction(ctx contractapi.TransactionContextInterface, auctionID string, auction *Auction) error {
+	key, err := auctionStateKey(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	auctionBytes, err := json.Marshal(auction)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, auctionBytes)
+}
+
+// CreateBond posts a new, empty collateral bond for the caller's
+// organization under bondID
+func (s *SmartContract) CreateBond(ctx contractapi.TransactionContextInterface, bondID string) error {
+	key, err := bondStateKey(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read bond: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("bond %s already exists", bondID)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	return s.putBond(ctx, bondID, &Bond{OwnerMSP: clientOrgID, Balance: 0})
+}
+
+// TopUpBond moves the amount supplied via transient data from the caller's
+// account balance into their bond
+func (s *SmartContract) TopUpBond(ctx contractapi.TransactionContextInterface, bondID string) error {
+	transientData, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient data: %v", err)
+	}
+
+	amountBytes, ok := transientData["amount"]
+	if !ok {
+		return fmt.Errorf("amount not found in transient data")
+	}
+
+	type TopUpBondData struct {
+		Amount         int    `json:"amount"`
+		IdempotencyKey string `json:"idempotencyKey"`
+	}
+
+	var data TopUpBondData
+	if err := json.Unmarshal(amountBytes, &data); err != nil {
+		return fmt.Errorf("error unmarshaling amount: %v", err)
+	}
+	if data.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	if record, err := s.checkIdempotency(ctx, clientOrgID, data.IdempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
+	bond, err := s.getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if bond.OwnerMSP != clientOrgID {
+		return fmt.Errorf("bond %s does not belong to %s", bondID, clientOrgID)
+	}
+
+	accountBytes, err := ctx.GetStub().GetState(clientOrgID)
+	if err != nil {
+		return fmt.Errorf("failed to read account: %v", err)
+	}
+	var account Account
+	if accountBytes != nil {
+		if err := json.Unmarshal(accountBytes, &account); err != nil {
+			return err
+		}
+	}
+	if account.Balance < data.Amount {
+		return fmt.Errorf("insufficient balance: have %d, need %d", account.Balance, data.Amount)
+	}
+
+	account.Balance -= data.Amount
+	bond.Balance += data.Amount
+
+	accountBytes, err = json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(clientOrgID, accountBytes); err != nil {
+		return err
+	}
+
+	if err := s.putBond(ctx, bondID, bond); err != nil {
+		return err
+	}
+
+	return s.recordIdempotency(ctx, clientOrgID, data.IdempotencyKey, fmt.Sprintf("bondBalance=%d", bond.Balance))
+}
+
+// SetName registers or renews a human-readable name pointing at one of the
+// caller's own documents, charging nameRenewalFee against bondID. Expired
+// names are reclaimable by any organization with a bond.
+func (s *SmartContract) SetName(ctx contractapi.TransactionContextInterface, name string, docID string, bondID string, idempotencyKey string) error {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	if record, err := s.checkIdempotency(ctx, clientOrgID, idempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
+	bond, err := s.getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if bond.OwnerMSP != clientOrgID {
+		return fmt.Errorf("bond %s does not belong to %s", bondID, clientOrgID)
+	}
+	if bond.Balance < nameRenewalFee {
+		return fmt.Errorf("bond %s has insufficient balance to renew: have %d, need %d", bondID, bond.Balance, nameRenewalFee)
+	}
+
+	collectionName := fmt.Sprintf("_implicit_org_%s", clientOrgID)
+	docJSON, err := ctx.GetStub().GetPrivateData(collectionName, docID)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %v", err)
+	}
+	if docJSON == nil {
+		return fmt.Errorf("document %s not found", docID)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(docJSON, &doc); err != nil {
+		return err
+	}
+
+	key, err := nameStateKey(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+
+	existingBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read name record: %v", err)
+	}
+	if existingBytes != nil {
+		var existing NameRecord
+		if err := json.Unmarshal(existingBytes, &existing); err != nil {
+			return err
+		}
+		if existing.OwnerMSP != clientOrgID && existing.ExpiryTs > txTimestamp.Seconds {
+			return fmt.Errorf("name %s is owned by %s until %d", name, existing.OwnerMSP, existing.ExpiryTs)
+		}
+	}
+
+	bond.Balance -= nameRenewalFee
+	if err := s.putBond(ctx, bondID, bond); err != nil {
+		return err
+	}
+
+	record := NameRecord{
+		Name:        name,
+		DocDataHash: doc.DocDataHash,
+		OwnerMSP:    clientOrgID,
+		ExpiryTs:    txTimestamp.Seconds + nameRenewalPeriodSeconds,
+		BondID:      bondID,
+	}
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, recordBytes); err != nil {
+		return err
+	}
+
+	return s.recordIdempotency(ctx, clientOrgID, idempotencyKey, fmt.Sprintf("name=%s expiryTs=%d", name, record.ExpiryTs))
+}
+
+// ResolveName returns the DocDataHash a live (non-expired) name currently
+// points at, so off-chain clients can fetch the actual document from the
+// owning organization's private collection
+func (s *SmartContract) ResolveName(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	key, err := nameStateKey(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	recordBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read name record: %v", err)
+	}
+	if recordBytes == nil {
+		return "", fmt.Errorf("name %s is not registered", name)
+	}
+
+	var record NameRecord
+	if err := json.Unmarshal(recordBytes, &record); err != nil {
+		return "", err
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if record.ExpiryTs <= txTimestamp.Seconds {
+		return "", fmt.Errorf("name %s has expired", name)
+	}
+
+	return record.DocDataHash, nil
+}
+
+// CreateAuction opens a sealed-bid auction for name, with commitDeadline and
+// revealDeadline given as Unix seconds enforced against the ledger's own
+// transaction timestamp
+func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, name string, commitDeadline int64, revealDeadline int64) error {
+	if revealDeadline <= commitDeadline {
+		return fmt.Errorf("revealDeadline must be after commitDeadline")
+	}
+
+	key, err := auctionStateKey(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read auction: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("auction %s already exists", auctionID)
+	}
+
+	auction := Auction{
+		AuctionID:      auctionID,
+		Name:           name,
+		Phase:          AuctionPhaseCommit,
+		CommitDeadline: commitDeadline,
+		RevealDeadline: revealDeadline,
+	}
+
+	return s.putAuction(ctx, auctionID, &auction)
+}
+
+// CommitBid records a sealed bid (sha256(bid||nonce)) from the caller in an
+// auction's commit phase
+func (s *SmartContract) CommitBid(ctx contractapi.TransactionContextInterface, auctionID string, commitHash string) error {
+	auction, err := s.getAuction(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if auction.Phase != AuctionPhaseCommit || txTimestamp.Seconds > auction.CommitDeadline {
+		return fmt.Errorf("auction %s is not accepting commits", auctionID)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	for _, bid := range auction.Bids {
+		if bid.BidderMSP == clientOrgID {
+			return fmt.Errorf("%s has already committed a bid in auction %s", clientOrgID, auctionID)
+		}
+	}
+
+	auction.Bids = append(auction.Bids, Bid{BidderMSP: clientOrgID, CommitHash: commitHash})
+
+	return s.putAuction(ctx, auctionID, auction)
+}
+
+// RevealBid discloses a previously committed bid amount and nonce, and
+// verifies it matches the stored commitment
+func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, auctionID string, amount int, nonce string) error {
+	if amount < 0 {
+		return fmt.Errorf("amount must not be negative")
+	}
+
+	auction, err := s.getAuction(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if txTimestamp.Seconds <= auction.CommitDeadline || txTimestamp.Seconds > auction.RevealDeadline {
+		return fmt.Errorf("auction %s is not in its reveal window", auctionID)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	if auction.Phase == AuctionPhaseCommit {
+		auction.Phase = AuctionPhaseReveal
+	}
+
+	found := false
+	for i := range auction.Bids {
+		bid := &auction.Bids[i]
+		if bid.BidderMSP != clientOrgID || bid.Revealed {
+			continue
+		}
+
+		hash := sha256.Sum256([]byte(strconv.Itoa(amount) + nonce))
+		if hex.EncodeToString(hash[:]) != bid.CommitHash {
+			return fmt.Errorf("revealed bid does not match commitment")
+		}
+
+		bid.Amount = amount
+		bid.Nonce = nonce
+		bid.Revealed = true
+		found = true
+		break
+	}
+
+	if !found {
+		return fmt.Errorf("no outstanding commitment from %s in auction %s", clientOrgID, auctionID)
+	}
+
+	return s.putAuction(ctx, auctionID, auction)
+}
+
+// resolveAuctionWinner computes the second-price winner among an auction's
+// revealed bids, skipping any bidder MSP present in disqualified. It is a
+// pure function (no ledger access) so the settlement math can be unit
+// tested directly: hasWinner is false when nobody eligible revealed, and a
+// negative winning or settlement amount is rejected outright rather than
+// silently crediting the wrong side of the trade. FinaliseAuction calls
+// this repeatedly, growing disqualified, to fall through to the
+// next-highest bidder when the current winner turns out to be unpayable or
+// ineligible, instead of leaving the auction stuck forever.
+func resolveAuctionWinner(bids []Bid, disqualified map[string]bool) (winner Bid, price int, hasWinner bool, err error) {
+	revealed := make([]Bid, 0, len(bids))
+	for _, bid := range bids {
+		if bid.Revealed && !disqualified[bid.BidderMSP] {
+			revealed = append(revealed, bid)
+		}
+	}
+	if len(revealed) == 0 {
+		return Bid{}, 0, false, nil
+	}
+
+	sort.Slice(revealed, func(i, j int) bool { return revealed[i].Amount > revealed[j].Amount })
+
+	winner = revealed[0]
+	if winner.Amount < 0 {
+		return Bid{}, 0, false, fmt.Errorf("winning bid amount cannot be negative")
+	}
+
+	price = winner.Amount
+	if len(revealed) > 1 {
+		price = revealed[1].Amount
+	}
+	if price < 0 {
+		return Bid{}, 0, false, fmt.Errorf("settlement price cannot be negative")
+	}
+
+	return winner, price, true, nil
+}
+
+// FinaliseAuction closes an auction past its reveal deadline, computes the
+// second-price winner among revealed bids, debits the winner's account
+// balance, and transfers ownership of the auctioned name
+func (s *SmartContract) FinaliseAuction(ctx contractapi.TransactionContextInterface, auctionID string, idempotencyKey string) error {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client org ID: %v", err)
+	}
+
+	if record, err := s.checkIdempotency(ctx, clientOrgID, idempotencyKey); err != nil {
+		return err
+	} else if record != nil {
+		return nil
+	}
+
+	auction, err := s.getAuction(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if auction.Phase == AuctionPhaseFinalised {
+		return fmt.Errorf("auction %s has already been finalised", auctionID)
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if txTimestamp.Seconds <= auction.RevealDeadline {
+		return fmt.Errorf("auction %s has not reached its reveal deadline yet", auctionID)
+	}
+
+	nameKey, err := nameStateKey(ctx, auction.Name)
+	if err != nil {
+		return err
+	}
+
+	var record NameRecord
+	existingBytes, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return fmt.Errorf("failed to read name record: %v", err)
+	}
+	if existingBytes != nil {
+		if err := json.Unmarshal(existingBytes, &record); err != nil {
+			return err
+		}
+	} else {
+		record.Name = auction.Name
+	}
+
+	// Walk down the revealed bids from highest to lowest, disqualifying
+	// whoever can't actually take the name (still-owned-by-someone-else, or
+	// can't cover the second-price settlement) and re-settling against the
+	// next one down, so an unpayable or ineligible top bid can't wedge the
+	// auction in AuctionPhaseReveal forever.
+	disqualified := make(map[string]bool)
+	var winner Bid
+	var price int
+	var hasWinner bool
+	var winnerAccount Account
+	for {
+		winner, price, hasWinner, err = resolveAuctionWinner(auction.Bids, disqualified)
+		if err != nil {
+			return err
+		}
+		if !hasWinner {
+			break
+		}
+		if record.OwnerMSP != winner.BidderMSP && record.ExpiryTs > txTimestamp.Seconds {
+			disqualified[winner.BidderMSP] = true
+			continue
+		}
+
+		winnerAccountBytes, err := ctx.GetStub().GetState(winner.BidderMSP)
+		if err != nil {
+			return fmt.Errorf("failed to read account: %v", err)
+		}
+		winnerAccount = Account{}
+		if winnerAccountBytes != nil {
+			if err := json.Unmarshal(winnerAccountBytes, &winnerAccount); err != nil {
+				return err
+			}
+		}
+		if winnerAccount.Balance < price {
+			disqualified[winner.BidderMSP] = true
+			continue
+		}
+		break
+	}
+
+	auction.Phase = AuctionPhaseFinalised
+
+	if !hasWinner {
+		// Every revealed bidder was either outbid by an unexpired owner or
+		// couldn't cover settlement: forfeit the auction rather than leave
+		// it open.
+		if err := s.putAuction(ctx, auctionID, auction); err != nil {
+			return err
+		}
+		return s.recordIdempotency(ctx, clientOrgID, idempotencyKey, "forfeited")
+	}
+
+	winnerAccount.Balance -= price
+	winnerAccountBytes, err := json.Marshal(winnerAccount)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(winner.BidderMSP, winnerAccountBytes); err != nil {
+		return err
+	}
+
+	record.OwnerMSP = winner.BidderMSP
+	record.ExpiryTs = txTimestamp.Seconds + nameRenewalPeriodSeconds
+	// The auction never collects a bond from the winner, so any bond the
+	// previous owner attached via SetName no longer applies to this name.
+	record.BondID = ""
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(nameKey, recordBytes); err != nil {
+		return err
+	}
+
+	auction.Winner = winner.BidderMSP
+
+	if err := s.putAuction(ctx, auctionID, auction); err != nil {
+		return err
+	}
+
+	return s.recordIdempotency(ctx, clientOrgID, idempotencyKey, fmt.Sprintf("winner=%s price=%d", winner.BidderMSP, price))
+}
+
+// emitEvent marshals payload and sets it as this transaction's chaincode
+// event, so external services can subscribe via the Fabric event service.
+// Fabric only carries one chaincode event per transaction, so callers must
+// use it at most once per invocation.
+func (s *SmartContract) emitEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent(name, payloadJSON)
+}
+
 func main() {
 	assetChaincode, err := contractapi.NewChaincode(&SmartContract{})
 	if err != nil {
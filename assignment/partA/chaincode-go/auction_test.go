@@ -0,0 +1,100 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import "testing"
+
+func TestResolveAuctionWinnerSecondPrice(t *testing.T) {
+	bids := []Bid{
+		{BidderMSP: "Org1MSP", Amount: 100, Revealed: true},
+		{BidderMSP: "Org2MSP", Amount: 80, Revealed: true},
+		{BidderMSP: "Org3MSP", Amount: 60, Revealed: true},
+		{BidderMSP: "Org4MSP", Revealed: false}, // never revealed, must be ignored
+	}
+
+	winner, price, hasWinner, err := resolveAuctionWinner(bids, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !hasWinner {
+		t.Fatalf("expected a winner")
+	}
+	if winner.BidderMSP != "Org1MSP" {
+		t.Fatalf("expected Org1MSP to win, got %s", winner.BidderMSP)
+	}
+	if price != 80 {
+		t.Fatalf("expected second-price settlement of 80, got %d", price)
+	}
+}
+
+func TestResolveAuctionWinnerSkipsDisqualifiedBidders(t *testing.T) {
+	bids := []Bid{
+		{BidderMSP: "Org1MSP", Amount: 100, Revealed: true},
+		{BidderMSP: "Org2MSP", Amount: 80, Revealed: true},
+		{BidderMSP: "Org3MSP", Amount: 60, Revealed: true},
+	}
+
+	winner, price, hasWinner, err := resolveAuctionWinner(bids, map[string]bool{"Org1MSP": true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !hasWinner || winner.BidderMSP != "Org2MSP" {
+		t.Fatalf("expected Org2MSP to win once Org1MSP is disqualified, got %+v", winner)
+	}
+	if price != 60 {
+		t.Fatalf("expected second-price settlement of 60 among the remaining bidders, got %d", price)
+	}
+}
+
+func TestResolveAuctionWinnerSingleRevealedBid(t *testing.T) {
+	bids := []Bid{{BidderMSP: "Org1MSP", Amount: 50, Revealed: true}}
+
+	winner, price, hasWinner, err := resolveAuctionWinner(bids, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !hasWinner || winner.BidderMSP != "Org1MSP" {
+		t.Fatalf("expected Org1MSP to win as the sole bidder")
+	}
+	if price != 50 {
+		t.Fatalf("expected sole bidder to pay their own bid of 50, got %d", price)
+	}
+}
+
+func TestResolveAuctionWinnerNoRevealedBids(t *testing.T) {
+	bids := []Bid{{BidderMSP: "Org1MSP", Revealed: false}}
+
+	winner, price, hasWinner, err := resolveAuctionWinner(bids, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hasWinner {
+		t.Fatalf("expected no winner, got %+v at price %d", winner, price)
+	}
+}
+
+func TestResolveAuctionWinnerRejectsNegativeWinningBid(t *testing.T) {
+	// RevealBid already rejects negative amounts, but resolveAuctionWinner
+	// must not trust that independently: a sole negative bidder would
+	// otherwise be credited money instead of debited.
+	bids := []Bid{{BidderMSP: "Org1MSP", Amount: -10, Revealed: true}}
+
+	if _, _, _, err := resolveAuctionWinner(bids, nil); err == nil {
+		t.Fatalf("expected an error for a negative winning bid")
+	}
+}
+
+func TestResolveAuctionWinnerRejectsNegativeSettlementPrice(t *testing.T) {
+	// A colluding second bidder revealing a large negative amount must not
+	// be able to turn the real winner's settlement price negative.
+	bids := []Bid{
+		{BidderMSP: "Org1MSP", Amount: 100, Revealed: true},
+		{BidderMSP: "Org2MSP", Amount: -1000, Revealed: true},
+	}
+
+	if _, _, _, err := resolveAuctionWinner(bids, nil); err == nil {
+		t.Fatalf("expected an error for a negative settlement price")
+	}
+}
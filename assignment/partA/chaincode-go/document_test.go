@@ -0,0 +1,65 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import "testing"
+
+func TestPaginateKeysFirstPage(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	page, nextBookmark := paginateKeys(keys, "", 2)
+	if len(page) != 2 || page[0] != "a" || page[1] != "b" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if nextBookmark != "b" {
+		t.Fatalf("expected next bookmark 'b', got %q", nextBookmark)
+	}
+}
+
+func TestPaginateKeysFollowsBookmark(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	page, nextBookmark := paginateKeys(keys, "b", 2)
+	if len(page) != 2 || page[0] != "c" || page[1] != "d" {
+		t.Fatalf("unexpected page after bookmark: %+v", page)
+	}
+	if nextBookmark != "d" {
+		t.Fatalf("expected next bookmark 'd', got %q", nextBookmark)
+	}
+}
+
+func TestPaginateKeysLastPageHasNoBookmark(t *testing.T) {
+	keys := []string{"a", "b", "c"}
+
+	page, nextBookmark := paginateKeys(keys, "b", 5)
+	if len(page) != 1 || page[0] != "c" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+	if nextBookmark != "" {
+		t.Fatalf("expected no next bookmark once the range is exhausted, got %q", nextBookmark)
+	}
+}
+
+func TestPaginateKeysZeroPageSizeReturnsEverything(t *testing.T) {
+	keys := []string{"a", "b", "c"}
+
+	page, nextBookmark := paginateKeys(keys, "", 0)
+	if len(page) != 3 {
+		t.Fatalf("expected all keys with an unbounded page size, got %+v", page)
+	}
+	if nextBookmark != "" {
+		t.Fatalf("expected no next bookmark, got %q", nextBookmark)
+	}
+}
+
+func TestPaginateKeysEmptyInput(t *testing.T) {
+	page, nextBookmark := paginateKeys(nil, "", 10)
+	if len(page) != 0 {
+		t.Fatalf("expected no keys, got %+v", page)
+	}
+	if nextBookmark != "" {
+		t.Fatalf("expected no next bookmark, got %q", nextBookmark)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// selfSignedEndorsement builds an Endorsement whose SignerCertB64 carries a
+// freshly generated, self-signed ECDSA certificate, with SigB64 set to a
+// valid ASN.1 signature of messageHash under that certificate's key.
+func selfSignedEndorsement(t *testing.T, signerMSP, signerCN string, messageHash []byte) Endorsement {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: signerCN},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(24 * time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, messageHash)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	return Endorsement{
+		SignerMSP:     signerMSP,
+		SignerCN:      signerCN,
+		SigB64:        base64.StdEncoding.EncodeToString(sig),
+		SignerCertB64: base64.StdEncoding.EncodeToString(certDER),
+	}
+}
+
+func TestVerifyEndorsementSignatureValid(t *testing.T) {
+	messageHash := sha256.Sum256([]byte("docHash+docID"))
+	endorsement := selfSignedEndorsement(t, "Org1MSP", "alice", messageHash[:])
+
+	valid, reason := verifyEndorsementSignature(endorsement, messageHash[:])
+	if !valid {
+		t.Fatalf("expected a freshly signed endorsement to verify, got reason: %s", reason)
+	}
+}
+
+func TestVerifyEndorsementSignatureRejectsTamperedMessage(t *testing.T) {
+	messageHash := sha256.Sum256([]byte("docHash+docID"))
+	endorsement := selfSignedEndorsement(t, "Org1MSP", "alice", messageHash[:])
+
+	tamperedHash := sha256.Sum256([]byte("a different document"))
+	valid, reason := verifyEndorsementSignature(endorsement, tamperedHash[:])
+	if valid {
+		t.Fatalf("expected verification to fail once the document changes")
+	}
+	if reason == "" {
+		t.Fatalf("expected a reason to be reported alongside the failure")
+	}
+}
+
+func TestVerifyEndorsementSignatureRejectsInvalidCertEncoding(t *testing.T) {
+	endorsement := Endorsement{SignerCertB64: "not-base64!!", SigB64: ""}
+
+	valid, reason := verifyEndorsementSignature(endorsement, []byte("irrelevant"))
+	if valid {
+		t.Fatalf("expected an invalid certificate encoding to fail verification")
+	}
+	if reason != "invalid stored certificate encoding" {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+}
+
+func TestRemoveEndorsementRemovesMatchingSignerOnly(t *testing.T) {
+	endorsements := []Endorsement{
+		{SignerMSP: "Org1MSP", SignerCN: "alice"},
+		{SignerMSP: "Org1MSP", SignerCN: "bob"},
+		{SignerMSP: "Org2MSP", SignerCN: "alice"},
+	}
+
+	remaining, removed := removeEndorsement(endorsements, "Org1MSP", "alice")
+	if !removed {
+		t.Fatalf("expected a matching endorsement to be removed")
+	}
+	if len(remaining) != 2 {
+		t.Fatalf("expected 2 endorsements to remain, got %d", len(remaining))
+	}
+	for _, e := range remaining {
+		if e.SignerMSP == "Org1MSP" && e.SignerCN == "alice" {
+			t.Fatalf("removed endorsement is still present: %+v", e)
+		}
+	}
+}
+
+func TestRemoveEndorsementNoMatch(t *testing.T) {
+	endorsements := []Endorsement{{SignerMSP: "Org1MSP", SignerCN: "alice"}}
+
+	remaining, removed := removeEndorsement(endorsements, "Org2MSP", "alice")
+	if removed {
+		t.Fatalf("expected no endorsement to match a different signer MSP")
+	}
+	if len(remaining) != 1 {
+		t.Fatalf("expected the untouched endorsement to remain, got %d", len(remaining))
+	}
+}
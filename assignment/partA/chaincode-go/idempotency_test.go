@@ -0,0 +1,31 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import "testing"
+
+func TestIsIdempotencyRecordExpiredWithinTTL(t *testing.T) {
+	record := IdempotencyRecord{TxID: "tx1", Timestamp: 1000, Result: "ok"}
+
+	if isIdempotencyRecordExpired(record, 1000+idempotencyTTLSeconds) {
+		t.Fatalf("expected a record exactly at the TTL boundary to still be live")
+	}
+}
+
+func TestIsIdempotencyRecordExpiredPastTTL(t *testing.T) {
+	record := IdempotencyRecord{TxID: "tx1", Timestamp: 1000, Result: "ok"}
+
+	if !isIdempotencyRecordExpired(record, 1000+idempotencyTTLSeconds+1) {
+		t.Fatalf("expected a record past the TTL boundary to be expired")
+	}
+}
+
+func TestIsIdempotencyRecordExpiredImmediately(t *testing.T) {
+	record := IdempotencyRecord{TxID: "tx1", Timestamp: 1000, Result: "ok"}
+
+	if isIdempotencyRecordExpired(record, 1000) {
+		t.Fatalf("expected a fresh record to not be expired")
+	}
+}
@@ -0,0 +1,48 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import "testing"
+
+func TestComputePurchaseTransfer(t *testing.T) {
+	newBuyer, newSeller, err := computePurchaseTransfer(100, 10, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if newBuyer != 70 {
+		t.Fatalf("expected buyer balance 70, got %d", newBuyer)
+	}
+	if newSeller != 40 {
+		t.Fatalf("expected seller balance 40, got %d", newSeller)
+	}
+}
+
+func TestComputePurchaseTransferInsufficientBalance(t *testing.T) {
+	if _, _, err := computePurchaseTransfer(10, 0, 30); err == nil {
+		t.Fatalf("expected an error when the buyer can't cover the price")
+	}
+}
+
+func TestComputePurchaseTransferRejectsNonPositivePrice(t *testing.T) {
+	if _, _, err := computePurchaseTransfer(100, 0, 0); err == nil {
+		t.Fatalf("expected an error for a zero price")
+	}
+	if _, _, err := computePurchaseTransfer(100, 0, -5); err == nil {
+		t.Fatalf("expected an error for a negative price")
+	}
+}
+
+func TestVerifyDocumentDataHash(t *testing.T) {
+	// sha256("hello") = 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+	const data = "hello"
+	const validHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	if err := verifyDocumentDataHash(data, validHash); err != nil {
+		t.Fatalf("unexpected error for a matching hash: %v", err)
+	}
+	if err := verifyDocumentDataHash(data, "deadbeef"); err == nil {
+		t.Fatalf("expected an error for a mismatched hash")
+	}
+}